@@ -0,0 +1,187 @@
+package signals
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"toolman.org/base/log"
+)
+
+var (
+	diagtx sync.Mutex
+	diagw  io.Writer = os.Stderr
+)
+
+// SetDiagnosticsWriter sets the destination diagnostics dumps triggered by
+// EnableDiagnostics are written to. The default is os.Stderr.
+func SetDiagnosticsWriter(w io.Writer) {
+	diagtx.Lock()
+	diagw = w
+	diagtx.Unlock()
+}
+
+// SetDiagnosticsFile routes diagnostics dumps to a file under dir named
+// with the dump's timestamp, rather than a single growing file. The
+// timestamp has one-second resolution, so dumps taken within the same
+// second are appended to the same file.
+func SetDiagnosticsFile(dir string) {
+	diagtx.Lock()
+	diagw = &rotatingDiagnosticsFile{dir: dir}
+	diagtx.Unlock()
+}
+
+type rotatingDiagnosticsFile struct {
+	dir string
+}
+
+func (r *rotatingDiagnosticsFile) Write(p []byte) (int, error) {
+	name := filepath.Join(r.dir, fmt.Sprintf("diag-%s.log", time.Now().Format("20060102T150405")))
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.Write(p)
+}
+
+// EnableDiagnostics registers a soft handler on sig -- the platform's
+// defaultDiagnosticsSignal (SIGUSR1 on Unix) if sig is nil -- that dumps a
+// full goroutine stack trace, runtime.MemStats and a GC summary to the
+// writer set by SetDiagnosticsWriter or SetDiagnosticsFile (os.Stderr by
+// default). It's an opt-in operational hook for inspecting a long-running
+// daemon without attaching a debugger. On platforms with no default
+// signal for this (Windows, Plan 9), passing nil is a no-op; pass an
+// explicit sig to install the handler there anyway.
+func EnableDiagnostics(sig os.Signal) Registration {
+	if sig == nil {
+		sig = defaultDiagnosticsSignal()
+	}
+	if sig == nil {
+		return nil
+	}
+
+	return RegisterSoftHandler(func(os.Signal) bool {
+		dumpDiagnostics()
+		return true
+	}, sig)
+}
+
+// dumpDiagnostics assembles the full dump in memory and issues exactly one
+// Write to the destination writer. This matters for a SetDiagnosticsFile
+// destination, which opens a freshly-timestamped file on every Write:
+// writing the dump in several calls (even through a bufio.Writer, which
+// bypasses its buffer for any single write larger than it) would split
+// one dump across two differently-named files whenever the goroutine
+// dump alone exceeds the buffer size, which it routinely does.
+func dumpDiagnostics() {
+	diagtx.Lock()
+	w := diagw
+	diagtx.Unlock()
+
+	buf := make([]byte, 1<<20)
+	n := runtime.Stack(buf, true)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "=== goroutine dump: %s ===\n%s\n", time.Now(), buf[:n])
+	fmt.Fprintf(&out, "=== memstats: alloc=%d sys=%d numgc=%d ===\n", ms.Alloc, ms.Sys, ms.NumGC)
+	fmt.Fprintf(&out, "=== gc: numgc=%d lastgc=%s pausetotal=%s ===\n", gc.NumGC, gc.LastGC, gc.PauseTotal)
+
+	if _, err := w.Write(out.Bytes()); err != nil {
+		log.Errorf("signals: writing diagnostics: %v", err)
+	}
+}
+
+// EnableProfileToggle registers a soft handler on sig -- the platform's
+// defaultProfileToggleSignal (SIGUSR2 on Unix) if sig is nil -- that
+// starts CPU profiling and takes a heap snapshot into dir on its first
+// delivery, then on its next delivery takes a second heap snapshot and
+// stops (flushing to disk) the CPU profile, alternating on each
+// subsequent delivery. The pair of heap snapshots lets a before/after
+// comparison of the interval be run through `go tool pprof -base`. On
+// platforms with no default signal for this (Windows, Plan 9), passing
+// nil is a no-op; pass an explicit sig to install the handler there
+// anyway.
+func EnableProfileToggle(sig os.Signal, dir string) Registration {
+	if sig == nil {
+		sig = defaultProfileToggleSignal()
+	}
+	if sig == nil {
+		return nil
+	}
+
+	var (
+		ptx     sync.Mutex
+		running bool
+		cpuf    *os.File
+	)
+
+	return RegisterSoftHandler(func(os.Signal) bool {
+		ptx.Lock()
+		defer ptx.Unlock()
+
+		writeHeapProfile(dir)
+
+		if running {
+			pprof.StopCPUProfile()
+			cpuf.Close()
+			cpuf = nil
+			running = false
+			log.Infof("signals: profiling stopped")
+			return true
+		}
+
+		stamp := time.Now().Format("20060102T150405")
+
+		var err error
+		if cpuf, err = os.Create(filepath.Join(dir, fmt.Sprintf("cpu-%s.pprof", stamp))); err != nil {
+			log.Errorf("signals: creating cpu profile: %v", err)
+			return true
+		}
+
+		if err := pprof.StartCPUProfile(cpuf); err != nil {
+			log.Errorf("signals: starting cpu profile: %v", err)
+			cpuf.Close()
+			cpuf = nil
+			return true
+		}
+
+		running = true
+		log.Infof("signals: profiling started, writing to %s", dir)
+		return true
+	}, sig)
+}
+
+// writeHeapProfile writes a single heap snapshot into dir, named with the
+// current timestamp, logging rather than returning any error since it's
+// always called from a context -- EnableProfileToggle's handler -- that
+// has no caller to report it to.
+func writeHeapProfile(dir string) {
+	stamp := time.Now().Format("20060102T150405")
+
+	heapf, err := os.Create(filepath.Join(dir, fmt.Sprintf("heap-%s.pprof", stamp)))
+	if err != nil {
+		log.Errorf("signals: creating heap profile: %v", err)
+		return
+	}
+	defer heapf.Close()
+
+	if err := pprof.WriteHeapProfile(heapf); err != nil {
+		log.Errorf("signals: writing heap profile: %v", err)
+	}
+}
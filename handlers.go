@@ -2,24 +2,37 @@
 package signals // import "toolman.org/base/signals"
 
 import (
+	"errors"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"toolman.org/base/log"
 	"toolman.org/base/runtimeutil"
 )
 
+// defaultBufSize is the default size of the buffered channel signals are
+// delivered through; see SetBufferSize.
+const defaultBufSize = 16
+
 var (
-	utx      sync.Mutex
+	utx      sync.RWMutex
 	on       bool
 	handlers map[os.Signal][]*handler
-	nch      chan os.Signal
+	sch      chan os.Signal // fed directly by signal.Notify
+	nch      chan os.Signal // buffered, drained by handleSignals
 	done     chan struct{}
 	down     chan struct{}
+
+	bufSize = defaultBufSize
+
+	cdtx               sync.RWMutex
+	concurrentDispatch bool
+
+	received, dropped, delivered uint64
 )
 
 // Handler is a function for handling signals; it should be passed to either
@@ -36,11 +49,81 @@ type handler struct {
 	info *runtimeutil.FunctionInfo
 }
 
+// ErrAlreadyStarted is returned by SetBufferSize if it's called after the
+// first handler has already been registered.
+var ErrAlreadyStarted = errors.New("signals: buffer size must be set before the first handler is registered")
+
+// ErrInvalidBufferSize is returned by SetBufferSize if n is not positive.
+var ErrInvalidBufferSize = errors.New("signals: buffer size must be positive")
+
+// SetBufferSize sets the size of the buffered channel signals are queued
+// on before being dispatched to their handlers, replacing defaultBufSize.
+// It must be called before the first call to RegisterHandler or
+// RegisterSoftHandler, and returns ErrAlreadyStarted otherwise. n must be
+// positive, or SetBufferSize returns ErrInvalidBufferSize rather than
+// deferring the failure to the make(chan os.Signal, bufSize) in register,
+// which would panic on an unrelated call for a negative size and build an
+// unbuffered channel for a zero size. A larger buffer tolerates
+// larger bursts of signals without dropping them while a handler is
+// running; see Stats for a way to observe drops.
+func SetBufferSize(n int) error {
+	if n <= 0 {
+		return ErrInvalidBufferSize
+	}
+
+	utx.Lock()
+	defer utx.Unlock()
+
+	if on {
+		return ErrAlreadyStarted
+	}
+
+	bufSize = n
+	return nil
+}
+
+// SetConcurrentDispatch controls how a handler chain is run relative to
+// registration. By default (false) dispatch holds the same lock used by
+// RegisterHandler/RegisterSoftHandler/Registration.Unregister for the
+// duration of the handler chain, serializing the two. Passing true
+// instead has dispatch take only a read lock long enough to copy the
+// handler slice, then run the chain unlocked, so registration isn't
+// blocked behind a slow handler.
+func SetConcurrentDispatch(b bool) {
+	cdtx.Lock()
+	concurrentDispatch = b
+	cdtx.Unlock()
+}
+
+func concurrentDispatchEnabled() bool {
+	cdtx.RLock()
+	defer cdtx.RUnlock()
+	return concurrentDispatch
+}
+
+// Counters reports the signal accounting exposed by Stats.
+type Counters struct {
+	Received  uint64
+	Dropped   uint64
+	Delivered uint64
+}
+
+// Stats reports the number of signals this package has seen (Received),
+// the number it was unable to queue because the buffered channel was
+// full (Dropped), and the number it ran a handler chain for (Delivered).
+func Stats() Counters {
+	return Counters{
+		Received:  atomic.LoadUint64(&received),
+		Dropped:   atomic.LoadUint64(&dropped),
+		Delivered: atomic.LoadUint64(&delivered),
+	}
+}
+
 // Stop is called to stop all signal processing. When Stop returns, it is
 // guaranteed that no further signal processing will occur.
 func Stop() {
 	if on {
-		signal.Stop(nch)
+		signal.Stop(sch)
 		close(done)
 		<-down
 		on = false
@@ -50,20 +133,22 @@ func Stop() {
 // RegisterHandler registers h as a hander for each signal s. When a signal is
 // received, each of its registered handlers is called in the order in which
 // they were registered -- until one of the handlers returns false or the list
-// of handlers is exhausted.
-func RegisterHandler(h Handler, s ...os.Signal) {
-	register(&handler{h, false, runtimeutil.FuncID(h)}, s)
+// of handlers is exhausted. The returned Registration can be used to remove
+// just this handler without affecting any others registered for the same
+// signals.
+func RegisterHandler(h Handler, s ...os.Signal) Registration {
+	return register(&handler{h, false, runtimeutil.FuncID(h)}, s)
 }
 
 // RegisterSoftHandler registers h as a signal handler in the same manner as
 // RegisterHandler however, if any subsequent handler is registered for any
 // of the signals listed here, this handler will be replaced by the new
 // handler instead of appending it to the list of registered handlers.
-func RegisterSoftHandler(h Handler, s ...os.Signal) {
-	register(&handler{h, true, runtimeutil.FuncID(h)}, s)
+func RegisterSoftHandler(h Handler, s ...os.Signal) Registration {
+	return register(&handler{h, true, runtimeutil.FuncID(h)}, s)
 }
 
-func register(h *handler, sl []os.Signal) {
+func register(h *handler, sl []os.Signal) Registration {
 	utx.Lock()
 	defer utx.Unlock()
 
@@ -73,12 +158,13 @@ func register(h *handler, sl []os.Signal) {
 		handlers = make(map[os.Signal][]*handler)
 		done = make(chan struct{})
 		down = make(chan struct{})
-		nch = make(chan os.Signal)
+		sch = make(chan os.Signal, bufSize)
+		nch = make(chan os.Signal, bufSize)
 	}
 
 	for _, s := range sl {
 		if _, ok := handlers[s]; !ok {
-			signal.Notify(nch, s)
+			signal.Notify(sch, s)
 		}
 
 		if lh := len(handlers[s]); lh > 0 && handlers[s][lh-1].soft {
@@ -89,41 +175,39 @@ func register(h *handler, sl []os.Signal) {
 	}
 
 	if !on {
+		go relaySignals()
 		go handleSignals()
 		on = true
 	}
-}
-
-func registerOne(f func(), s os.Signal) {
-	RegisterHandler(func(os.Signal) bool { f(); return true }, s)
-}
-
-func OnSIGHUP(f func()) {
-	registerOne(f, syscall.SIGHUP)
-}
-
-func OnSIGINT(f func()) {
-	registerOne(f, syscall.SIGINT)
-}
 
-func OnSIGTERM(f func()) {
-	registerOne(f, syscall.SIGTERM)
+	return &registration{h, sl}
 }
 
-func OnSIGCHLD(f func()) {
-	registerOne(f, syscall.SIGCHLD)
+func registerOne(f func(), s os.Signal) Registration {
+	return RegisterHandler(func(os.Signal) bool { f(); return true }, s)
 }
 
-func OnSIGUSR1(f func()) {
-	registerOne(f, syscall.SIGUSR1)
-}
-
-func OnSIGUSR2(f func()) {
-	registerOne(f, syscall.SIGUSR2)
-}
+// relaySignals forwards signals from sch -- the channel registered with
+// signal.Notify -- onto the buffered nch that handleSignals drains. The
+// forward is non-blocking: if nch is full (handleSignals is stuck behind
+// a slow handler holding utx), the signal is counted as dropped rather
+// than blocking delivery of the next one.
+func relaySignals() {
+	for {
+		select {
+		case <-done:
+			return
 
-func OnSIGWINCH(f func()) {
-	registerOne(f, syscall.SIGWINCH)
+		case s := <-sch:
+			atomic.AddUint64(&received, 1)
+			select {
+			case nch <- s:
+			default:
+				atomic.AddUint64(&dropped, 1)
+				log.V(1).Infof("signals: dropped signal %v: buffer full", s)
+			}
+		}
+	}
 }
 
 func handleSignals() {
@@ -142,22 +226,39 @@ func handleSignals() {
 				log.Infof("%s: handling signal %d", id, s)
 			}
 
-			func(s os.Signal) {
-				log.V(2).Infof("%s: in handler subfunc", id)
-				utx.Lock()
-				defer utx.Unlock()
-				log.V(2).Infof("%s: lock acquired", id)
-				for _, h := range handlers[s] {
-					log.V(2).Infof("%s: calling handler: %s", id, h.info.Name())
-					if !h.hdlr(s) {
-						log.V(2).Infof("%s: handler %s: returned false", id, h.info.Name())
-						return
-					}
-					log.V(2).Infof("%s: handler %s: returned true", id, h.info.Name())
-				}
-			}(s)
+			dispatch(id, s)
+			atomic.AddUint64(&delivered, 1)
 
 			log.V(2).Infof("%s: done handling signal %d", id, s)
 		}
 	}
 }
+
+// dispatch runs the handler chain registered for s. When concurrent
+// dispatch is disabled (the default), it holds utx for the duration of
+// the chain, serializing dispatch against registration exactly as before
+// this package supported SetConcurrentDispatch. When enabled, it only
+// holds a read lock long enough to copy the handler slice.
+func dispatch(id string, s os.Signal) {
+	var hl []*handler
+
+	if concurrentDispatchEnabled() {
+		utx.RLock()
+		hl = append([]*handler(nil), handlers[s]...)
+		utx.RUnlock()
+	} else {
+		utx.Lock()
+		defer utx.Unlock()
+		hl = handlers[s]
+	}
+
+	log.V(2).Infof("%s: lock acquired", id)
+	for _, h := range hl {
+		log.V(2).Infof("%s: calling handler: %s", id, h.info.Name())
+		if !h.hdlr(s) {
+			log.V(2).Infof("%s: handler %s: returned false", id, h.info.Name())
+			return
+		}
+		log.V(2).Infof("%s: handler %s: returned true", id, h.info.Name())
+	}
+}
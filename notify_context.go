@@ -0,0 +1,41 @@
+package signals
+
+import (
+	"context"
+	"os"
+)
+
+// NotifyContext returns a copy of parent with a new Done channel. The
+// returned context's Done channel is closed when one of the listed
+// signals arrives, when the returned stop function is called, or when
+// parent's Done channel is closed, whichever happens first.
+//
+// NotifyContext is a drop-in equivalent of stdlib's signal.NotifyContext,
+// implemented on top of this package's handler registry -- the internal
+// handler it installs takes part in the same ordered handler chain as any
+// other handler registered via RegisterHandler. It is not a soft handler,
+// so a later registration for an overlapping signal -- e.g. the shutdown
+// handler installed by RegisterShutdownHandler -- appends after it rather
+// than evicting it, and it likewise appends after another non-soft
+// handler. Like any registration, it does replace a soft handler that is
+// last in a signal's handler list.
+// The returned stop function both cancels the context and unregisters
+// the internal handler, so repeated use (e.g. in tests) doesn't leak
+// handler slots.
+func NotifyContext(parent context.Context, sig ...os.Signal) (ctx context.Context, stop context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	fn := func(os.Signal) bool {
+		cancel()
+		return true
+	}
+
+	reg := RegisterHandler(fn, sig...)
+
+	stop = func() {
+		cancel()
+		reg.Unregister()
+	}
+
+	return ctx, stop
+}
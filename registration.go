@@ -0,0 +1,53 @@
+package signals
+
+import (
+	"os"
+	"os/signal"
+)
+
+// Registration represents a single call to RegisterHandler or
+// RegisterSoftHandler. It can be used to remove that handler from every
+// signal it was registered for without affecting any other handler --
+// mirroring the per-channel add/remove model of os/signal, where Stop is
+// scoped to a single channel rather than tearing down all notification.
+type Registration interface {
+	// Unregister removes this handler from every signal it was
+	// registered for. If removing it empties a signal's handler list,
+	// signal.Reset is called for that signal to restore its default
+	// disposition.
+	Unregister()
+}
+
+type registration struct {
+	h  *handler
+	sl []os.Signal
+}
+
+func (r *registration) Unregister() {
+	deregister(r.h, r.sl)
+}
+
+// deregister removes h from the handler list for every signal in sl. If a
+// signal's handler list becomes empty, signal.Reset is called for that
+// signal so its default disposition is restored.
+func deregister(h *handler, sl []os.Signal) {
+	utx.Lock()
+	defer utx.Unlock()
+
+	for _, s := range sl {
+		hl := handlers[s]
+		for i, hh := range hl {
+			if hh == h {
+				hl = append(hl[:i], hl[i+1:]...)
+				break
+			}
+		}
+
+		if len(hl) == 0 {
+			delete(handlers, s)
+			signal.Reset(s)
+		} else {
+			handlers[s] = hl
+		}
+	}
+}
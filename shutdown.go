@@ -0,0 +1,149 @@
+package signals
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+
+	"toolman.org/base/log"
+)
+
+// ErrHandlerExists is returned by RegisterShutdownHandler when a handler
+// with the given name has already been registered.
+var ErrHandlerExists = errors.New("signals: shutdown handler already registered")
+
+// shutdownHandler pairs a named, ordered shutdown callback with the order
+// in which it should run relative to its peers.
+type shutdownHandler struct {
+	name  string
+	order int
+	seq   int
+	fn    func(os.Signal) error
+}
+
+var (
+	sdtx      sync.Mutex
+	sdinit    bool
+	sdseq     int
+	shandlers map[string]*shutdownHandler
+
+	inhibittx sync.RWMutex
+
+	drainingtx sync.RWMutex
+	draining   bool
+)
+
+// RegisterShutdownHandler registers fn to run when the process receives
+// SIGINT or SIGTERM, alongside every other registered shutdown handler.
+// Handlers run in ascending order of the order argument; handlers sharing
+// an order run in registration order. Unlike RegisterHandler's early-exit
+// chain, every registered shutdown handler runs regardless of whether an
+// earlier one returns an error -- errors are logged and the walk
+// continues. RegisterShutdownHandler returns ErrHandlerExists if name has
+// already been registered.
+func RegisterShutdownHandler(name string, order int, fn func(os.Signal) error) error {
+	sdtx.Lock()
+	defer sdtx.Unlock()
+
+	if shandlers == nil {
+		shandlers = make(map[string]*shutdownHandler)
+	}
+
+	if _, ok := shandlers[name]; ok {
+		return ErrHandlerExists
+	}
+
+	sdseq++
+	shandlers[name] = &shutdownHandler{name: name, order: order, seq: sdseq, fn: fn}
+
+	if !sdinit {
+		RegisterHandler(shutdownDispatch, syscall.SIGINT, syscall.SIGTERM)
+		sdinit = true
+	}
+
+	return nil
+}
+
+// UnregisterShutdownHandler removes the shutdown handler previously
+// registered under name, if any.
+func UnregisterShutdownHandler(name string) {
+	sdtx.Lock()
+	defer sdtx.Unlock()
+	delete(shandlers, name)
+}
+
+// InhibitShutdown blocks the shutdown handler chain from running until a
+// matching call to UninhibitShutdown. It is intended for critical sections
+// that must not be interrupted by SIGINT/SIGTERM; callers must always pair
+// it with UninhibitShutdown, typically via defer.
+func InhibitShutdown() {
+	inhibittx.RLock()
+}
+
+// UninhibitShutdown releases a lock acquired by InhibitShutdown.
+func UninhibitShutdown() {
+	inhibittx.RUnlock()
+}
+
+// ShutdownInProgress reports whether a shutdown has been triggered. It
+// returns true from the moment SIGINT or SIGTERM is first dispatched --
+// including while the chain is still waiting out InhibitShutdown callers
+// -- through the run of the chain and after it has completed.
+func ShutdownInProgress() bool {
+	drainingtx.RLock()
+	defer drainingtx.RUnlock()
+	return draining
+}
+
+// shutdownDispatch is installed as an ordered handler for SIGINT/SIGTERM
+// (registered with RegisterHandler, not RegisterSoftHandler, so it can't
+// be silently evicted by another feature -- e.g. NotifyContext -- that
+// registers for the same signals). It must never block while dispatch
+// holds utx, so it only marks the shutdown as started and hands the
+// actual work -- which includes waiting out InhibitShutdown, a wait with
+// no bound -- off to runShutdown on its own goroutine.
+func shutdownDispatch(sig os.Signal) bool {
+	drainingtx.Lock()
+	already := draining
+	draining = true
+	drainingtx.Unlock()
+
+	if !already {
+		go runShutdown(sig)
+	}
+
+	return true
+}
+
+// runShutdown waits out any InhibitShutdown callers, then walks the
+// registered shutdown handlers in order, logging -- but not aborting on
+// -- errors. It runs on its own goroutine, outside of the utx lock that
+// serializes dispatch against registration, so an inhibited shutdown
+// never blocks RegisterHandler, RegisterSoftHandler, Registration.Unregister
+// or any of the other utx-holding APIs.
+func runShutdown(sig os.Signal) {
+	inhibittx.Lock()
+	defer inhibittx.Unlock()
+
+	sdtx.Lock()
+	ordered := make([]*shutdownHandler, 0, len(shandlers))
+	for _, h := range shandlers {
+		ordered = append(ordered, h)
+	}
+	sdtx.Unlock()
+
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].order != ordered[j].order {
+			return ordered[i].order < ordered[j].order
+		}
+		return ordered[i].seq < ordered[j].seq
+	})
+
+	for _, h := range ordered {
+		if err := h.fn(sig); err != nil {
+			log.Errorf("shutdown handler %q: %v", h.name, err)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package signals
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSignal lets these tests exercise the handler chain and the
+// shutdown subsystem without depending on real OS signal delivery.
+type fakeSignal string
+
+func (f fakeSignal) String() string { return string(f) }
+func (f fakeSignal) Signal()        {}
+
+func TestRegisterHandlerOrderAndEarlyExit(t *testing.T) {
+	sig := fakeSignal("test-order")
+	var calls []int
+
+	r1 := RegisterHandler(func(os.Signal) bool { calls = append(calls, 1); return true }, sig)
+	defer r1.Unregister()
+	r2 := RegisterHandler(func(os.Signal) bool { calls = append(calls, 2); return false }, sig)
+	defer r2.Unregister()
+	r3 := RegisterHandler(func(os.Signal) bool { calls = append(calls, 3); return true }, sig)
+	defer r3.Unregister()
+
+	dispatch("", sig)
+
+	if want := []int{1, 2}; !equalInts(calls, want) {
+		t.Fatalf("calls = %v, want %v (handler 2 returns false and should stop the chain before handler 3 runs)", calls, want)
+	}
+}
+
+func TestRegisterSoftHandlerReplacesPriorSoftHandler(t *testing.T) {
+	sig := fakeSignal("test-soft")
+	var last int
+
+	r1 := RegisterSoftHandler(func(os.Signal) bool { last = 1; return true }, sig)
+	r2 := RegisterSoftHandler(func(os.Signal) bool { last = 2; return true }, sig)
+	defer r2.Unregister()
+
+	dispatch("", sig)
+
+	if last != 2 {
+		t.Fatalf("last = %d, want 2 (second soft registration should replace the first)", last)
+	}
+
+	// r1 was already evicted by r2's registration; unregistering it must
+	// not disturb r2.
+	r1.Unregister()
+	last = 0
+	dispatch("", sig)
+	if last != 2 {
+		t.Fatalf("last = %d after unregistering the evicted handler, want 2", last)
+	}
+}
+
+func TestUnregisterRemovesOnlyThatHandler(t *testing.T) {
+	sig := fakeSignal("test-unregister")
+	var aRan, bRan bool
+
+	ra := RegisterHandler(func(os.Signal) bool { aRan = true; return true }, sig)
+	rb := RegisterHandler(func(os.Signal) bool { bRan = true; return true }, sig)
+	defer rb.Unregister()
+
+	ra.Unregister()
+	dispatch("", sig)
+
+	if aRan || !bRan {
+		t.Fatalf("aRan=%v bRan=%v, want aRan=false bRan=true after unregistering only the first handler", aRan, bRan)
+	}
+}
+
+func TestNotifyContextCancelsAndStopUnregisters(t *testing.T) {
+	sig := fakeSignal("test-ctx")
+	ctx, stop := NotifyContext(context.Background(), sig)
+	defer stop()
+
+	dispatch("", sig)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled after dispatching a matching signal")
+	}
+
+	utx.RLock()
+	before := len(handlers[sig])
+	utx.RUnlock()
+
+	stop()
+
+	utx.RLock()
+	after := len(handlers[sig])
+	utx.RUnlock()
+
+	if after != before-1 {
+		t.Fatalf("handlers[sig] length = %d after stop, want %d (stop should unregister its handler)", after, before-1)
+	}
+}
+
+func TestNotifyContextAndShutdownHandlerDoNotClobberEachOther(t *testing.T) {
+	resetShutdownState(t)
+
+	// os.Interrupt is one of the signals RegisterShutdownHandler installs
+	// shutdownDispatch on, so both features share one handler list here.
+	sig := os.Interrupt
+	ctx, stop := NotifyContext(context.Background(), sig)
+	defer stop()
+
+	ran := make(chan struct{})
+	if err := RegisterShutdownHandler("coexist", 0, func(os.Signal) error {
+		close(ran)
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterShutdownHandler: %v", err)
+	}
+	defer UnregisterShutdownHandler("coexist")
+
+	dispatch("", sig)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("NotifyContext's handler was evicted by the shutdown handler registering for the same signal")
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown handler never ran")
+	}
+}
+
+func TestShutdownHandlersRunInOrderAndSurviveErrors(t *testing.T) {
+	resetShutdownState(t)
+
+	var mu sync.Mutex
+	var ran []string
+
+	must := func(name string, order int, fn func(os.Signal) error) {
+		if err := RegisterShutdownHandler(name, order, fn); err != nil {
+			t.Fatalf("RegisterShutdownHandler(%q): %v", name, err)
+		}
+	}
+
+	must("second", 2, func(os.Signal) error {
+		mu.Lock()
+		ran = append(ran, "second")
+		mu.Unlock()
+		return nil
+	})
+	must("first", 1, func(os.Signal) error {
+		mu.Lock()
+		ran = append(ran, "first")
+		mu.Unlock()
+		return errors.New("boom")
+	})
+
+	if err := RegisterShutdownHandler("first", 1, func(os.Signal) error { return nil }); err != ErrHandlerExists {
+		t.Fatalf("RegisterShutdownHandler with duplicate name: got %v, want ErrHandlerExists", err)
+	}
+
+	runShutdown(fakeSignal("test-shutdown"))
+
+	mu.Lock()
+	got := append([]string(nil), ran...)
+	mu.Unlock()
+
+	if want := []string{"first", "second"}; !equalStrings(got, want) {
+		t.Fatalf("ran = %v, want %v (handlers should run in ascending order despite \"first\" returning an error)", got, want)
+	}
+}
+
+func TestShutdownDispatchDoesNotBlockRegistrationWhileInhibited(t *testing.T) {
+	resetShutdownState(t)
+
+	ran := make(chan struct{})
+	if err := RegisterShutdownHandler("inhibit-test", 0, func(os.Signal) error {
+		close(ran)
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterShutdownHandler: %v", err)
+	}
+	defer UnregisterShutdownHandler("inhibit-test")
+
+	InhibitShutdown()
+
+	done := make(chan struct{})
+	go func() {
+		shutdownDispatch(fakeSignal("test-inhibit"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdownDispatch blocked while holding utx instead of handing off to its own goroutine")
+	}
+
+	if !ShutdownInProgress() {
+		t.Fatal("ShutdownInProgress() = false immediately after shutdownDispatch, want true")
+	}
+
+	regDone := make(chan struct{})
+	go func() {
+		RegisterHandler(func(os.Signal) bool { return true }, fakeSignal("test-inhibit-reg")).Unregister()
+		close(regDone)
+	}()
+
+	select {
+	case <-regDone:
+	case <-time.After(time.Second):
+		t.Fatal("RegisterHandler blocked behind an in-progress, inhibited shutdown")
+	}
+
+	select {
+	case <-ran:
+		t.Fatal("shutdown handler ran before UninhibitShutdown was called")
+	default:
+	}
+
+	UninhibitShutdown()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown handler never ran after UninhibitShutdown")
+	}
+}
+
+func TestSetBufferSizeAfterStartReturnsErrAlreadyStarted(t *testing.T) {
+	sig := fakeSignal("test-bufsize")
+	r := RegisterHandler(func(os.Signal) bool { return true }, sig)
+	defer r.Unregister()
+
+	if err := SetBufferSize(64); err != ErrAlreadyStarted {
+		t.Fatalf("SetBufferSize after start: got %v, want ErrAlreadyStarted", err)
+	}
+}
+
+func TestSetBufferSizeRejectsNonPositive(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if err := SetBufferSize(n); err != ErrInvalidBufferSize {
+			t.Fatalf("SetBufferSize(%d): got %v, want ErrInvalidBufferSize", n, err)
+		}
+	}
+}
+
+// TestStatsCountsReceivedDroppedAndDelivered drives signals through sch --
+// the channel relaySignals reads from -- directly, since real OS signal
+// delivery isn't available for a fakeSignal. It stalls handleSignals
+// behind a slow handler so nch fills up, forcing some of the signals
+// sent while it's stalled to be dropped, then confirms Stats reflects
+// exactly that.
+func TestStatsCountsReceivedDroppedAndDelivered(t *testing.T) {
+	// Guarantee the subsystem (and its channels) are already started
+	// before this test writes to sch directly -- a send on a nil,
+	// not-yet-created channel would hang forever.
+	r := RegisterHandler(func(os.Signal) bool { return true }, fakeSignal("test-stats-start"))
+	defer r.Unregister()
+
+	utx.RLock()
+	capacity := cap(nch)
+	utx.RUnlock()
+
+	blockSig := fakeSignal("test-stats-block")
+	gate := make(chan struct{})
+	entered := make(chan struct{}, 1)
+
+	rb := RegisterHandler(func(os.Signal) bool {
+		entered <- struct{}{}
+		<-gate
+		return true
+	}, blockSig)
+	defer rb.Unregister()
+
+	before := Stats()
+
+	sch <- blockSig
+	<-entered // handleSignals is now stuck inside the slow handler
+
+	fillerSig := fakeSignal("test-stats-filler")
+	const extra = 3
+	for i := 0; i < capacity+extra; i++ {
+		sch <- fillerSig
+	}
+
+	wantReceived := before.Received + uint64(capacity+extra+1)
+	waitForStat(t, func() uint64 { return Stats().Received }, wantReceived)
+
+	if got := Stats().Dropped - before.Dropped; got != uint64(extra) {
+		t.Fatalf("Dropped increased by %d, want %d (nch only has room for %d of the %d filler signals sent while the slow handler held it up)", got, extra, capacity, capacity+extra)
+	}
+
+	close(gate)
+
+	wantDelivered := before.Delivered + uint64(capacity+1)
+	waitForStat(t, func() uint64 { return Stats().Delivered }, wantDelivered)
+}
+
+// waitForStat polls get until it reaches want or a second passes.
+func waitForStat(t *testing.T, get func() uint64, want uint64) {
+	t.Helper()
+
+	deadline := time.After(time.Second)
+	for {
+		if got := get(); got >= want {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("stat never reached %d, got %d", want, get())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestSetConcurrentDispatchStillDeliversInOrder(t *testing.T) {
+	SetConcurrentDispatch(true)
+	defer SetConcurrentDispatch(false)
+
+	sig := fakeSignal("test-concurrent")
+	var mu sync.Mutex
+	var calls []int
+
+	record := func(n int, cont bool) Handler {
+		return func(os.Signal) bool {
+			mu.Lock()
+			calls = append(calls, n)
+			mu.Unlock()
+			return cont
+		}
+	}
+
+	r1 := RegisterHandler(record(1, true), sig)
+	defer r1.Unregister()
+	r2 := RegisterHandler(record(2, false), sig)
+	defer r2.Unregister()
+	r3 := RegisterHandler(record(3, true), sig)
+	defer r3.Unregister()
+
+	dispatch("", sig)
+
+	mu.Lock()
+	got := append([]int(nil), calls...)
+	mu.Unlock()
+
+	if want := []int{1, 2}; !equalInts(got, want) {
+		t.Fatalf("calls = %v, want %v (concurrent dispatch's RLock path should run the chain in order and still stop at the first false)", got, want)
+	}
+}
+
+func TestDumpDiagnosticsWritesExpectedSections(t *testing.T) {
+	var buf bytes.Buffer
+	SetDiagnosticsWriter(&buf)
+	defer SetDiagnosticsWriter(os.Stderr)
+
+	dumpDiagnostics()
+
+	out := buf.String()
+	for _, want := range []string{"=== goroutine dump:", "=== memstats:", "=== gc:"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("dump output missing section %q; got:\n%s", want, out)
+		}
+	}
+}
+
+func TestEnableProfileToggleWritesHeapSnapshotOnBothEdgesAndFlushesCPUProfile(t *testing.T) {
+	dir := t.TempDir()
+	sig := fakeSignal("test-profile-toggle")
+
+	reg := EnableProfileToggle(sig, dir)
+	if reg == nil {
+		t.Fatal("EnableProfileToggle returned a nil Registration")
+	}
+	defer reg.Unregister()
+
+	dispatch("", sig) // start edge: begins CPU profiling, takes a heap snapshot
+
+	cpuFiles, _ := filepath.Glob(filepath.Join(dir, "cpu-*.pprof"))
+	heapFiles, _ := filepath.Glob(filepath.Join(dir, "heap-*.pprof"))
+	if len(cpuFiles) != 1 {
+		t.Fatalf("cpu pprof files after start edge = %d, want 1", len(cpuFiles))
+	}
+	if len(heapFiles) != 1 {
+		t.Fatalf("heap pprof files after start edge = %d, want 1", len(heapFiles))
+	}
+
+	time.Sleep(1100 * time.Millisecond) // the filename timestamp has 1-second resolution
+
+	dispatch("", sig) // stop edge: takes a second heap snapshot, flushes and stops the CPU profile
+
+	heapFiles, _ = filepath.Glob(filepath.Join(dir, "heap-*.pprof"))
+	if len(heapFiles) != 2 {
+		t.Fatalf("heap pprof files after stop edge = %d, want 2 (one per edge, for a before/after comparison)", len(heapFiles))
+	}
+
+	info, err := os.Stat(cpuFiles[0])
+	if err != nil {
+		t.Fatalf("stat cpu profile: %v", err)
+	}
+	if info.Size() == 0 {
+		t.Fatal("cpu profile file is empty; StopCPUProfile should have flushed its buffered samples to it")
+	}
+}
+
+// resetShutdownState clears the package-level shutdown state so shutdown
+// tests don't interfere with each other or with whatever ran earlier in
+// the suite.
+func resetShutdownState(t *testing.T) {
+	t.Helper()
+
+	sdtx.Lock()
+	shandlers = make(map[string]*shutdownHandler)
+	sdseq = 0
+	sdtx.Unlock()
+
+	drainingtx.Lock()
+	draining = false
+	drainingtx.Unlock()
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
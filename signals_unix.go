@@ -0,0 +1,69 @@
+//go:build unix
+
+package signals
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func OnSIGHUP(f func()) Registration {
+	return registerOne(f, syscall.SIGHUP)
+}
+
+func OnSIGINT(f func()) Registration {
+	return registerOne(f, syscall.SIGINT)
+}
+
+func OnSIGTERM(f func()) Registration {
+	return registerOne(f, syscall.SIGTERM)
+}
+
+func OnSIGCHLD(f func()) Registration {
+	return registerOne(f, syscall.SIGCHLD)
+}
+
+func OnSIGUSR1(f func()) Registration {
+	return registerOne(f, syscall.SIGUSR1)
+}
+
+func OnSIGUSR2(f func()) Registration {
+	return registerOne(f, syscall.SIGUSR2)
+}
+
+func OnSIGWINCH(f func()) Registration {
+	return registerOne(f, syscall.SIGWINCH)
+}
+
+// OnInterrupt registers f to run when the process receives an interrupt
+// (SIGINT).
+func OnInterrupt(f func()) Registration {
+	return registerOne(f, os.Interrupt)
+}
+
+// OnTerminate registers f to run when the process is asked to terminate
+// (SIGTERM).
+func OnTerminate(f func()) Registration {
+	return registerOne(f, syscall.SIGTERM)
+}
+
+// TryOn registers fn as a handler for sig, returning an error if sig isn't
+// a signal this platform knows about. Every os.Signal accepted elsewhere
+// in this package is valid on Unix, so TryOn succeeds here for any
+// non-nil sig and returns an error only when sig is nil.
+func TryOn(sig os.Signal, fn func()) error {
+	if sig == nil {
+		return fmt.Errorf("signals: nil signal")
+	}
+	registerOne(fn, sig)
+	return nil
+}
+
+// defaultDiagnosticsSignal is the signal EnableDiagnostics installs on
+// when passed nil.
+func defaultDiagnosticsSignal() os.Signal { return syscall.SIGUSR1 }
+
+// defaultProfileToggleSignal is the signal EnableProfileToggle installs
+// on when passed nil.
+func defaultProfileToggleSignal() os.Signal { return syscall.SIGUSR2 }
@@ -0,0 +1,45 @@
+//go:build unix
+
+package signals
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestTryOnRejectsNilAndRegistersValidSignal(t *testing.T) {
+	if err := TryOn(nil, func() {}); err == nil {
+		t.Fatal("TryOn(nil, ...): got nil error, want an error")
+	}
+
+	var ran bool
+	if err := TryOn(syscall.SIGUSR1, func() { ran = true }); err != nil {
+		t.Fatalf("TryOn(syscall.SIGUSR1, ...): %v", err)
+	}
+
+	dispatch("", syscall.SIGUSR1)
+
+	if !ran {
+		t.Fatal("handler registered via TryOn never ran")
+	}
+}
+
+func TestOnInterruptAndOnTerminateRegisterTheirSignals(t *testing.T) {
+	var interrupted, terminated bool
+
+	ri := OnInterrupt(func() { interrupted = true })
+	defer ri.Unregister()
+	rt := OnTerminate(func() { terminated = true })
+	defer rt.Unregister()
+
+	dispatch("", os.Interrupt)
+	dispatch("", syscall.SIGTERM)
+
+	if !interrupted {
+		t.Fatal("OnInterrupt's handler never ran for os.Interrupt")
+	}
+	if !terminated {
+		t.Fatal("OnTerminate's handler never ran for syscall.SIGTERM")
+	}
+}
@@ -0,0 +1,56 @@
+//go:build windows
+
+package signals
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OnSIGHUP, OnSIGCHLD, OnSIGUSR1, OnSIGUSR2 and OnSIGWINCH have no
+// equivalent on Windows and are no-ops here; use TryOn if the absence of
+// the signal needs to be observable.
+
+func OnSIGHUP(f func()) Registration   { return nil }
+func OnSIGCHLD(f func()) Registration  { return nil }
+func OnSIGUSR1(f func()) Registration  { return nil }
+func OnSIGUSR2(f func()) Registration  { return nil }
+func OnSIGWINCH(f func()) Registration { return nil }
+
+func OnSIGINT(f func()) Registration {
+	return registerOne(f, os.Interrupt)
+}
+
+func OnSIGTERM(f func()) Registration {
+	return registerOne(f, syscall.SIGTERM)
+}
+
+// OnInterrupt registers f to run when the process receives an interrupt.
+func OnInterrupt(f func()) Registration {
+	return registerOne(f, os.Interrupt)
+}
+
+// OnTerminate registers f to run when the process is asked to terminate.
+func OnTerminate(f func()) Registration {
+	return registerOne(f, syscall.SIGTERM)
+}
+
+// TryOn registers fn as a handler for sig, returning an error if sig isn't
+// one of the signals Windows supports.
+func TryOn(sig os.Signal, fn func()) error {
+	switch sig {
+	case os.Interrupt, syscall.SIGTERM:
+		registerOne(fn, sig)
+		return nil
+	default:
+		return fmt.Errorf("signals: %v is not supported on windows", sig)
+	}
+}
+
+// defaultDiagnosticsSignal and defaultProfileToggleSignal return nil:
+// Windows has no SIGUSR1/SIGUSR2 equivalent, so EnableDiagnostics and
+// EnableProfileToggle are no-ops here unless called with an explicit
+// sig.
+func defaultDiagnosticsSignal() os.Signal   { return nil }
+func defaultProfileToggleSignal() os.Signal { return nil }